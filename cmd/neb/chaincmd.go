@@ -19,9 +19,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 
+	"github.com/nebulasio/go-nebulas/core/state"
 	"github.com/urfave/cli"
 )
 
@@ -35,6 +37,24 @@ var (
 		Description: `
 Use "./neb dump 10" to dump 10 blocks before tail block.`,
 	}
+
+	// KNOWN LIMITATION (chunk0-3): dumpStateCommand is not yet reachable.
+	// Like blockDumpCommand above, it only becomes a real "neb dump-state"
+	// subcommand once it's added to the app.Commands list built in
+	// cmd/neb/main.go, which this checkout does not include. Registering
+	// it is tracked as a separate follow-up; until then this is dead code,
+	// not a delivered CLI command.
+	dumpStateCommand = cli.Command{
+		Action:    dumpstate,
+		Name:      "dump-state",
+		Usage:     "Dump every account in the state trie of a block to JSON",
+		ArgsUsage: "<blocknumber>",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Description: `
+Use "./neb dump-state 10" to dump the full account state of block 10 as JSON,
+the equivalent of geth's debug_dumpBlock. Useful for diffing chain state
+across nodes or building a genesis snapshot from a live chain.`,
+	}
 )
 
 func dumpblock(ctx *cli.Context) error {
@@ -46,3 +66,31 @@ func dumpblock(ctx *cli.Context) error {
 	fmt.Printf("blockchain dump: %s\n", neb.BlockChain().Dump(count))
 	return nil
 }
+
+func dumpstate(ctx *cli.Context) error {
+	neb := makeNeb(ctx)
+	height, err := strconv.ParseUint(ctx.Args().First(), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	block := neb.BlockChain().GetBlockByHeight(height)
+	if block == nil {
+		return fmt.Errorf("block %d not found", height)
+	}
+	accState, err := block.AccountState()
+	if err != nil {
+		return err
+	}
+
+	dump, err := accState.Dump(state.DumpOpts{IncludeStorage: true})
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
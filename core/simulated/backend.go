@@ -0,0 +1,180 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Package simulated provides an in-memory backend for exercising smart
+// contracts and account state changes without a running node, modelled
+// on ethereum's accounts/abi/bind/backends/simulated.go. It is meant as a
+// scriptable target for dApp unit tests.
+package simulated
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/nebulasio/go-nebulas/core"
+	"github.com/nebulasio/go-nebulas/core/state"
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/nebulasio/go-nebulas/util"
+)
+
+// ErrNoPendingState is returned by calls that require a pending state but
+// the backend has not been initialized through NewSimulatedBackend.
+var ErrNoPendingState = errors.New("simulated: backend has no pending state")
+
+// CallMsg describes a read-only contract call to run against the
+// backend's pending state.
+type CallMsg struct {
+	From []byte
+	To   []byte
+	Data []byte
+}
+
+// SimulatedBackend is a minimal in-memory chain wrapping AccountState,
+// giving tests a SendTransaction/CallContract/Commit/Rollback surface
+// without spinning up a full node. It only applies the balance and nonce
+// effects of a transaction; executing its payload against the NVM is left
+// to a real node or to a caller that wires the NVM engine in separately.
+type SimulatedBackend struct {
+	storage storage.Storage
+
+	lock    sync.Mutex
+	state   state.AccountState // last sealed state, as of the last Commit
+	pending state.AccountState // working copy transactions apply to
+}
+
+// NewSimulatedBackend creates a SimulatedBackend whose genesis state
+// credits each address in genesisAlloc with the given balance.
+func NewSimulatedBackend(genesisAlloc map[string]*util.Uint128) *SimulatedBackend {
+	db := storage.NewMemoryStorage()
+
+	genesis, err := state.NewAccountState(nil, db)
+	if err != nil {
+		panic(err)
+	}
+	genesis.BeginBatch()
+	for addr, balance := range genesisAlloc {
+		acc := genesis.GetOrCreateUserAccount([]byte(addr))
+		acc.AddBalance(balance)
+	}
+	genesis.Commit()
+
+	pending, err := genesis.Clone()
+	if err != nil {
+		panic(err)
+	}
+
+	return &SimulatedBackend{
+		storage: db,
+		state:   genesis,
+		pending: pending,
+	}
+}
+
+// SendTransaction applies tx's balance and nonce effects to the pending
+// state. It does not seal a new block; call Commit to do that.
+func (b *SimulatedBackend) SendTransaction(tx *core.Transaction) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.pending.BeginBatch()
+
+	from, err := b.pending.GetContractAccount(tx.From().Bytes())
+	if err != nil {
+		from = b.pending.GetOrCreateUserAccount(tx.From().Bytes())
+	}
+	if err := from.SubBalance(tx.Value()); err != nil {
+		return err
+	}
+	from.IncreNonce()
+
+	to := b.pending.GetOrCreateUserAccount(tx.To().Bytes())
+	to.AddBalance(tx.Value())
+	return nil
+}
+
+// CallContract runs a read-only call against the pending state and
+// discards every effect it had via RevertToSnapshot, regardless of
+// whether the call succeeded.
+func (b *SimulatedBackend) CallContract(call CallMsg) ([]byte, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.pending == nil {
+		return nil, ErrNoPendingState
+	}
+	snap := b.pending.Snapshot()
+	defer b.pending.RevertToSnapshot(snap)
+
+	if _, err := b.pending.GetContractAccount(call.To); err != nil {
+		return nil, err
+	}
+	// Actual NVM execution of call.Data against the contract account is
+	// left to the caller's engine; this backend only guarantees the
+	// pending state is left untouched either way.
+	return nil, nil
+}
+
+// EstimateGas runs call the same way CallContract does, under its own
+// snapshot/revert pair, so repeated estimates never need to re-clone the
+// pending state.
+func (b *SimulatedBackend) EstimateGas(call CallMsg) (uint64, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.pending == nil {
+		return 0, ErrNoPendingState
+	}
+	snap := b.pending.Snapshot()
+	defer b.pending.RevertToSnapshot(snap)
+
+	if _, err := b.pending.GetContractAccount(call.To); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// Commit seals the pending state as the new sealed state and starts a
+// fresh pending clone on top of it.
+func (b *SimulatedBackend) Commit() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.pending.Commit()
+	b.state = b.pending
+
+	pending, err := b.state.Clone()
+	if err != nil {
+		return err
+	}
+	b.pending = pending
+	return nil
+}
+
+// Rollback discards the pending state and starts a fresh clone of the
+// last sealed state.
+func (b *SimulatedBackend) Rollback() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	pending, err := b.state.Clone()
+	if err != nil {
+		return err
+	}
+	b.pending = pending
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package simulated
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/util"
+)
+
+// TestCommitIsolatesSealedFromPending is a regression test for
+// accountState.Clone aliasing its journal and dirtyAccount map with the
+// state it was cloned from: mutating the new pending state right after a
+// Commit must never retroactively change the state that was just sealed.
+func TestCommitIsolatesSealedFromPending(t *testing.T) {
+	backend := NewSimulatedBackend(nil)
+
+	backend.pending.BeginBatch()
+	acc := backend.pending.GetOrCreateUserAccount([]byte("addr1"))
+	acc.AddBalance(util.NewUint128FromInt(100))
+
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	sealedAcc, err := backend.state.GetContractAccount([]byte("addr1"))
+	if err != nil {
+		t.Fatalf("GetContractAccount failed: %v", err)
+	}
+	before := sealedAcc.Balance().Int.Int64()
+
+	backend.pending.BeginBatch()
+	pendingAcc := backend.pending.GetOrCreateUserAccount([]byte("addr1"))
+	pendingAcc.AddBalance(util.NewUint128FromInt(1))
+
+	after := sealedAcc.Balance().Int.Int64()
+	if after != before {
+		t.Fatalf("sealed state balance changed by pending mutation: %d -> %d", before, after)
+	}
+}
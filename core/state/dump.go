@@ -0,0 +1,156 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package state
+
+import "github.com/nebulasio/go-nebulas/util/byteutils"
+
+// DumpAccount is the JSON-friendly view of a single account emitted by
+// Dump, mirroring the fields accountState itself tracks.
+type DumpAccount struct {
+	Address    string            `json:"address"`
+	Balance    string            `json:"balance"`
+	Nonce      uint64            `json:"nonce"`
+	VarsHash   string            `json:"varsHash"`
+	BirthPlace string            `json:"birthPlace,omitempty"`
+	Storage    map[string]string `json:"storage,omitempty"`
+}
+
+// Dump is a full or partial snapshot of accountState's accounts as of the
+// state trie root it was taken from.
+type Dump struct {
+	Root     string                 `json:"root"`
+	Accounts map[string]DumpAccount `json:"accounts"`
+	// Next is the address to resume a paginated Dump from, and is empty
+	// once the walk reached the end of the state trie.
+	Next []byte `json:"next,omitempty"`
+}
+
+// DumpOpts configures a Dump/IterateAccounts walk.
+type DumpOpts struct {
+	// IncludeStorage also walks and emits every key/value under each
+	// account's variables trie. Expensive for contract-heavy chains.
+	IncludeStorage bool
+	// OnlyWithAddresses restricts the walk to exactly these addresses, in
+	// the order given, instead of walking the whole state trie.
+	OnlyWithAddresses [][]byte
+	// Start resumes the walk from this address (exclusive of accounts
+	// ordered before it), for paginating a large dump across calls.
+	Start []byte
+	// MaxResults caps the number of accounts returned; 0 means no cap.
+	MaxResults int
+}
+
+// IterateAccounts walks every account in the state trie in address order,
+// starting at opts.Start if given, calling fn with each address and its
+// decoded Account. It stops early if fn returns false.
+func (as *accountState) IterateAccounts(opts DumpOpts, fn func(addr byteutils.Hash, acc Account) bool) error {
+	if len(opts.OnlyWithAddresses) > 0 {
+		for _, addr := range opts.OnlyWithAddresses {
+			acc, err := as.getAccount(addr)
+			if err != nil {
+				continue
+			}
+			if !fn(addr, acc) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	iter, err := as.stateTrie.Iterator(opts.Start)
+	if err != nil {
+		return err
+	}
+	exist, err := iter.Next()
+	for exist && err == nil {
+		addr := byteutils.Hash(iter.Key())
+		acc := new(account)
+		if err = acc.FromBytes(iter.Value(), as.storage); err != nil {
+			return err
+		}
+		if !fn(addr, acc) {
+			return nil
+		}
+		exist, err = iter.Next()
+	}
+	return err
+}
+
+// Dump walks the state trie according to opts and returns a JSON-friendly
+// snapshot of the accounts it visited, honouring opts.MaxResults and
+// leaving a resume cursor in Dump.Next when the cap was hit before the
+// walk finished.
+func (as *accountState) Dump(opts DumpOpts) (Dump, error) {
+	dump := Dump{
+		Root:     byteutils.Hex(as.stateTrie.RootHash()),
+		Accounts: make(map[string]DumpAccount),
+	}
+
+	count := 0
+	err := as.IterateAccounts(opts, func(addr byteutils.Hash, acc Account) bool {
+		if opts.MaxResults > 0 && count >= opts.MaxResults {
+			dump.Next = addr
+			return false
+		}
+
+		dumpAcc := DumpAccount{
+			Address:  byteutils.Hex(addr),
+			Balance:  acc.Balance().Int.String(),
+			Nonce:    acc.Nonce(),
+			VarsHash: byteutils.Hex(acc.VarsHash()),
+		}
+		if birthPlace := acc.BirthPlace(); len(birthPlace) > 0 {
+			dumpAcc.BirthPlace = byteutils.Hex(birthPlace)
+		}
+
+		if opts.IncludeStorage {
+			storage, err := dumpStorage(acc)
+			if err != nil {
+				return false
+			}
+			dumpAcc.Storage = storage
+		}
+
+		dump.Accounts[dumpAcc.Address] = dumpAcc
+		count++
+		return true
+	})
+	if err != nil {
+		return Dump{}, err
+	}
+	return dump, nil
+}
+
+// dumpStorage walks every key/value under acc's variables trie.
+func dumpStorage(acc Account) (map[string]string, error) {
+	storage := make(map[string]string)
+	iter, err := acc.Iterator(nil)
+	if err != nil {
+		return nil, err
+	}
+	exist, err := iter.Next()
+	for exist && err == nil {
+		storage[byteutils.Hex(iter.Key())] = byteutils.Hex(iter.Value())
+		exist, err = iter.Next()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package state
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/nebulasio/go-nebulas/util"
+)
+
+func TestDumpPagination(t *testing.T) {
+	as, err := NewAccountState(nil, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatalf("NewAccountState failed: %v", err)
+	}
+	as.BeginBatch()
+	for _, addr := range [][]byte{[]byte("addr1"), []byte("addr2"), []byte("addr3")} {
+		acc := as.GetOrCreateUserAccount(addr)
+		acc.AddBalance(util.NewUint128FromInt(1))
+	}
+	as.Commit()
+
+	sas, ok := as.(*accountState)
+	if !ok {
+		t.Fatalf("expected *accountState")
+	}
+
+	dump, err := sas.Dump(DumpOpts{MaxResults: 2})
+	if err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if len(dump.Accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(dump.Accounts))
+	}
+	if len(dump.Next) == 0 {
+		t.Fatalf("expected a resume cursor since MaxResults was hit")
+	}
+
+	rest, err := sas.Dump(DumpOpts{Start: dump.Next})
+	if err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if len(rest.Accounts) != 1 {
+		t.Fatalf("expected the remaining account, got %d", len(rest.Accounts))
+	}
+}
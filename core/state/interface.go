@@ -0,0 +1,90 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package state
+
+import (
+	"github.com/nebulasio/go-nebulas/core/state/snapshot"
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/nebulasio/go-nebulas/util"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+)
+
+// Iterator walks a key/value range in order, the shape returned by a
+// trie's own Iterator method.
+type Iterator interface {
+	Next() (bool, error)
+	Key() []byte
+	Value() []byte
+}
+
+// Account is a single account in the state trie, either a user account
+// (global storage) or a contract account (local storage, optional code).
+type Account interface {
+	ToBytes() ([]byte, error)
+	FromBytes(bytes []byte, storage storage.Storage) error
+
+	Balance() *util.Uint128
+	Nonce() uint64
+	VarsHash() byteutils.Hash
+	BirthPlace() byteutils.Hash
+
+	Code() ([]byte, error)
+	SetCode(code []byte) error
+	Suicide() bool
+	MarkSuicided()
+
+	BeginBatch()
+	Commit()
+	RollBack()
+
+	IncreNonce()
+	AddBalance(value *util.Uint128)
+	SubBalance(value *util.Uint128) error
+
+	Put(key []byte, value []byte) error
+	Get(key []byte) ([]byte, error)
+	Del(key []byte) error
+	Iterator(prefix []byte) (Iterator, error)
+
+	String() string
+}
+
+// AccountState manages every account rooted under a single state trie,
+// giving callers batching, journaled snapshot/revert, an optional
+// layered-snapshot read/write path, and a structured Dump.
+type AccountState interface {
+	SetSnapshot(snaps *snapshot.Tree)
+
+	RootHash() byteutils.Hash
+	GetOrCreateUserAccount(addr []byte) Account
+	GetContractAccount(addr []byte) (Account, error)
+	CreateContractAccount(addr []byte, birthPlace []byte) (Account, error)
+
+	BeginBatch()
+	Snapshot() int
+	RevertToSnapshot(id int)
+	Commit()
+	RollBack()
+	Clone() (AccountState, error)
+
+	IterateAccounts(opts DumpOpts, fn func(addr byteutils.Hash, acc Account) bool) error
+	Dump(opts DumpOpts) (Dump, error)
+
+	String() string
+}
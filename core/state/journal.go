@@ -0,0 +1,147 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package state
+
+import (
+	"github.com/nebulasio/go-nebulas/util"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+)
+
+// journalEntry is a single, reversible mutation recorded against an
+// account or the accountState itself. Each entry knows how to undo
+// exactly what it did, in place, on the cached object it recorded.
+type journalEntry interface {
+	revert()
+}
+
+// journal is an ordered log of journalEntry records made since the last
+// Commit or RollBack. Snapshot/RevertToSnapshot let callers unwind any
+// suffix of it, independent of the coarser BeginBatch/RollBack around a
+// whole transaction.
+type journal struct {
+	entries []journalEntry
+}
+
+func newJournal() *journal {
+	return &journal{}
+}
+
+// append records entry as the next mutation in the journal.
+func (j *journal) append(entry journalEntry) {
+	j.entries = append(j.entries, entry)
+}
+
+// length returns the current journal length, i.e. the id Snapshot would
+// hand out next.
+func (j *journal) length() int {
+	return len(j.entries)
+}
+
+// revert pops and reverses every entry down to, but not including, id.
+func (j *journal) revert(id int) {
+	for i := len(j.entries) - 1; i >= id; i-- {
+		j.entries[i].revert()
+	}
+	j.entries = j.entries[:id]
+}
+
+// reset discards every recorded entry without reverting them, used on
+// Commit once the underlying mutations are durable.
+func (j *journal) reset() {
+	j.entries = nil
+}
+
+// balanceChange records that acc's balance was about to change from prev.
+type balanceChange struct {
+	acc  *account
+	prev *util.Uint128
+}
+
+func (c balanceChange) revert() {
+	c.acc.balance = c.prev
+}
+
+// nonceChange records that acc's nonce was about to change from prev.
+type nonceChange struct {
+	acc  *account
+	prev uint64
+}
+
+func (c nonceChange) revert() {
+	c.acc.nonce = c.prev
+}
+
+// storagePut records that acc's storage at key was about to be
+// overwritten. existed tells revert whether to restore prev or delete the
+// key outright, since the zero value of prev is indistinguishable from an
+// empty stored value. prevDirty/hadDirty carry the same distinction for
+// acc.dirtyStorage, the in-batch write acc.Get reads through to before
+// the trie.
+type storagePut struct {
+	acc       *account
+	key       []byte
+	prev      []byte
+	existed   bool
+	prevDirty []byte
+	hadDirty  bool
+}
+
+func (c storagePut) revert() {
+	if c.existed {
+		c.acc.variables.Put(c.key, c.prev)
+	} else {
+		c.acc.variables.Del(c.key)
+	}
+	c.acc.revertDirtyStorage(c.key, c.prevDirty, c.hadDirty)
+}
+
+// storageDelete records that acc's storage at key was about to be
+// removed.
+type storageDelete struct {
+	acc       *account
+	key       []byte
+	prev      []byte
+	prevDirty []byte
+	hadDirty  bool
+}
+
+func (c storageDelete) revert() {
+	c.acc.variables.Put(c.key, c.prev)
+	c.acc.revertDirtyStorage(c.key, c.prevDirty, c.hadDirty)
+}
+
+// suicideChange records that acc was about to be marked suicided.
+type suicideChange struct {
+	acc *account
+}
+
+func (c suicideChange) revert() {
+	c.acc.suicided = false
+}
+
+// createAccount records that addr did not exist in as.dirtyAccount before
+// it was just created.
+type createAccount struct {
+	state *accountState
+	addr  byteutils.HexHash
+}
+
+func (c createAccount) revert() {
+	delete(c.state.dirtyAccount, c.addr)
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package state
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/nebulasio/go-nebulas/util"
+)
+
+func TestRevertToSnapshot(t *testing.T) {
+	as, err := NewAccountState(nil, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatalf("NewAccountState failed: %v", err)
+	}
+	as.BeginBatch()
+
+	acc := as.GetOrCreateUserAccount([]byte("a1"))
+	acc.AddBalance(util.NewUint128FromInt(100))
+
+	snap := as.Snapshot()
+	acc.AddBalance(util.NewUint128FromInt(50))
+	acc.IncreNonce()
+	if err := acc.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	as.RevertToSnapshot(snap)
+
+	if acc.Balance().Int.Int64() != 100 {
+		t.Fatalf("balance not reverted, got %v", acc.Balance().Int)
+	}
+	if acc.Nonce() != 0 {
+		t.Fatalf("nonce not reverted, got %v", acc.Nonce())
+	}
+	if _, err := acc.Get([]byte("k")); err == nil {
+		t.Fatalf("storage put should have been reverted")
+	}
+}
+
+func TestRevertToSnapshotUndoesSuicide(t *testing.T) {
+	as, err := NewAccountState(nil, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatalf("NewAccountState failed: %v", err)
+	}
+	as.BeginBatch()
+	acc := as.GetOrCreateUserAccount([]byte("a2"))
+
+	snap := as.Snapshot()
+	acc.MarkSuicided()
+	if !acc.Suicide() {
+		t.Fatalf("expected account to be marked suicided")
+	}
+
+	as.RevertToSnapshot(snap)
+	if acc.Suicide() {
+		t.Fatalf("suicide flag should have been reverted")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package snapshot
+
+import "hash/fnv"
+
+// bloomFilterBits / bloomFilterHashes size a bloom filter for a single
+// diffLayer. A layer typically dirties a few hundred keys at most (the
+// accounts and storage slots touched by one block), so a small filter
+// keeps the false-positive rate low without wasting memory across a deep
+// stack of layers.
+const (
+	bloomFilterBits   = 1 << 16 // 8KB per layer
+	bloomFilterHashes = 4
+)
+
+// bloomFilter is a minimal fixed-size bloom filter used by a diffLayer to
+// answer "definitely not present" in O(1) without touching its account
+// or storage maps.
+type bloomFilter struct {
+	bits []uint64
+}
+
+func newBloomFilter() *bloomFilter {
+	return &bloomFilter{bits: make([]uint64, bloomFilterBits/64)}
+}
+
+// add marks key as present in the filter.
+func (b *bloomFilter) add(key []byte) {
+	for _, h := range b.hashes(key) {
+		b.bits[h/64] |= 1 << (h % 64)
+	}
+}
+
+// contains returns false if key is definitely not in the filter, true if
+// it might be (subject to false positives).
+func (b *bloomFilter) contains(key []byte) bool {
+	for _, h := range b.hashes(key) {
+		if b.bits[h/64]&(1<<(h%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes derives bloomFilterHashes independent bit positions from key
+// using double hashing (two fnv hashes combined), avoiding the cost of
+// running bloomFilterHashes separate hash functions.
+func (b *bloomFilter) hashes(key []byte) [bloomFilterHashes]uint32 {
+	h1 := fnv.New64a()
+	h1.Write(key)
+	sum1 := h1.Sum64()
+
+	h2 := fnv.New64()
+	h2.Write(key)
+	sum2 := h2.Sum64()
+
+	var out [bloomFilterHashes]uint32
+	for i := 0; i < bloomFilterHashes; i++ {
+		out[i] = uint32((sum1 + uint64(i)*sum2) % bloomFilterBits)
+	}
+	return out
+}
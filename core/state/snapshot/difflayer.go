@@ -0,0 +1,148 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+)
+
+// diffLayer holds only what a single pending block changed relative to
+// its parent layer: a handful of dirtied accounts and storage slots, plus
+// a bloom filter over those keys so a miss can be ruled out without
+// touching the maps at all.
+type diffLayer struct {
+	root   byteutils.Hash // state trie root this layer represents
+	parent Snapshot       // layer below, either another diffLayer or the diskLayer
+
+	accountData map[byteutils.HexHash][]byte                       // dirtied accounts, nil blob means deleted
+	storageData map[byteutils.HexHash]map[byteutils.HexHash][]byte // dirtied storage slots, nil blob means deleted
+
+	diffed *bloomFilter // superset bloom of accountData and storageData keys
+
+	stale bool // whether this layer has been flattened away
+	lock  sync.RWMutex
+}
+
+// newDiffLayer builds a diffLayer on top of parent, indexing every
+// dirtied account and storage slot into a fresh bloom filter.
+func newDiffLayer(parent Snapshot, root byteutils.Hash, accounts map[byteutils.HexHash][]byte, storage map[byteutils.HexHash]map[byteutils.HexHash][]byte) *diffLayer {
+	dl := &diffLayer{
+		root:        root,
+		parent:      parent,
+		accountData: accounts,
+		storageData: storage,
+		diffed:      newBloomFilter(),
+	}
+	for addrHash := range accounts {
+		dl.diffed.add([]byte(addrHash))
+	}
+	for addrHash, slots := range storage {
+		for storageHash := range slots {
+			dl.diffed.add(diffBloomKey(addrHash, storageHash))
+		}
+	}
+	return dl
+}
+
+// Root implements Snapshot.
+func (dl *diffLayer) Root() byteutils.Hash {
+	return dl.root
+}
+
+// Parent implements Snapshot.
+func (dl *diffLayer) Parent() Snapshot {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+	return dl.parent
+}
+
+// Stale implements Snapshot.
+func (dl *diffLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+	return dl.stale
+}
+
+// Account implements Snapshot, walking down the layer stack until a hit is
+// found. A layer whose bloom filter rejects the key is passed over without
+// a map lookup; the walk then continues with its parent, not the disk layer.
+func (dl *diffLayer) Account(addrHash byteutils.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !dl.diffed.contains([]byte(addrHash.Hex())) {
+		return dl.parent.Account(addrHash)
+	}
+	if blob, ok := dl.accountData[addrHash.Hex()]; ok {
+		if blob == nil {
+			return nil, ErrNotFound
+		}
+		return blob, nil
+	}
+	return dl.parent.Account(addrHash)
+}
+
+// Storage implements Snapshot, walking down the layer stack the same way
+// Account does.
+func (dl *diffLayer) Storage(addrHash, storageHash byteutils.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !dl.diffed.contains(diffBloomKey(addrHash.Hex(), storageHash.Hex())) {
+		return dl.parent.Storage(addrHash, storageHash)
+	}
+	if slots, ok := dl.storageData[addrHash.Hex()]; ok {
+		if blob, ok := slots[storageHash.Hex()]; ok {
+			if blob == nil {
+				return nil, ErrNotFound
+			}
+			return blob, nil
+		}
+	}
+	return dl.parent.Storage(addrHash, storageHash)
+}
+
+// depth returns how many diffLayers separate this layer from the disk
+// layer, used by the Tree to decide when to flatten.
+func (dl *diffLayer) depth() int {
+	depth := 1
+	for p := dl.Parent(); p != nil; {
+		if d, ok := p.(*diffLayer); ok {
+			depth++
+			p = d.Parent()
+			continue
+		}
+		break
+	}
+	return depth
+}
+
+// diffBloomKey derives the bloom filter key for a storage slot by
+// concatenating its owning account's address hash with the slot hash.
+func diffBloomKey(addrHash, storageHash byteutils.HexHash) []byte {
+	return append([]byte(addrHash), []byte(storageHash)...)
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package snapshot
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+)
+
+// Key prefixes the disk layer uses to namespace its flat entries inside
+// the shared key/value storage engine.
+var (
+	snapshotAccountPrefix = []byte("snap-acc-")
+	snapshotStoragePrefix = []byte("snap-stg-")
+	snapshotGeneratorKey  = []byte("snap-generator")
+)
+
+// diskLayer is the persistent, flat key/value view of the last fully
+// committed state. It is the bottom of the layer stack: every diffLayer
+// ultimately flattens into it once it is old enough.
+type diskLayer struct {
+	db   storage.Storage // key/value store the flat state lives in
+	root byteutils.Hash  // state trie root this layer represents
+
+	// genMarker tracks how far the background generator has progressed
+	// rebuilding this layer from the state trie. nil means generation is
+	// complete (or was never needed); non-nil is the last address hash
+	// processed, so generation can resume after a crash.
+	genMarker  []byte
+	genPending chan struct{} // closed once generation completes
+
+	stale bool // whether this layer has been replaced by a new disk layer
+	lock  sync.RWMutex
+}
+
+// Root implements Snapshot.
+func (dl *diskLayer) Root() byteutils.Hash {
+	return dl.root
+}
+
+// Parent implements Snapshot. The disk layer has no parent.
+func (dl *diskLayer) Parent() Snapshot {
+	return nil
+}
+
+// Stale implements Snapshot.
+func (dl *diskLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+	return dl.stale
+}
+
+// Account implements Snapshot, returning the flat-encoded account blob
+// keyed by its address hash.
+func (dl *diskLayer) Account(addrHash byteutils.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if dl.genMarker != nil && bytes.Compare(addrHash, dl.genMarker) > 0 {
+		return nil, ErrNotCoveredYet
+	}
+	blob, err := dl.db.Get(accountKey(addrHash))
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return blob, nil
+}
+
+// Storage implements Snapshot, returning the raw storage slot value keyed
+// by the owning account's address hash and the slot hash.
+func (dl *diskLayer) Storage(addrHash, storageHash byteutils.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if dl.genMarker != nil && bytes.Compare(addrHash, dl.genMarker) > 0 {
+		return nil, ErrNotCoveredYet
+	}
+	blob, err := dl.db.Get(storageKey(addrHash, storageHash))
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return blob, nil
+}
+
+// merge writes every account and storage slot dirtied by diff directly
+// into the disk layer's key/value store, flattening it away. A nil blob
+// means the entry was deleted and is removed from the store instead of
+// written.
+func (dl *diskLayer) merge(diff *diffLayer) error {
+	diff.lock.RLock()
+	defer diff.lock.RUnlock()
+
+	for addrHash, blob := range diff.accountData {
+		addr, err := addrHash.Hash()
+		if err != nil {
+			return err
+		}
+		key := accountKey(addr)
+		if blob == nil {
+			if err := dl.db.Del(key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := dl.db.Put(key, blob); err != nil {
+			return err
+		}
+	}
+	for addrHash, slots := range diff.storageData {
+		addr, err := addrHash.Hash()
+		if err != nil {
+			return err
+		}
+		for storageHash, blob := range slots {
+			slot, err := storageHash.Hash()
+			if err != nil {
+				return err
+			}
+			key := storageKey(addr, slot)
+			if blob == nil {
+				if err := dl.db.Del(key); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := dl.db.Put(key, blob); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// accountKey returns the flat storage key an account is indexed under.
+func accountKey(addrHash byteutils.Hash) []byte {
+	return append(append([]byte{}, snapshotAccountPrefix...), addrHash...)
+}
+
+// storageKey returns the flat storage key a storage slot is indexed
+// under, namespaced by its owning account.
+func storageKey(addrHash, storageHash byteutils.Hash) []byte {
+	key := append(append([]byte{}, snapshotStoragePrefix...), addrHash...)
+	return append(key, storageHash...)
+}
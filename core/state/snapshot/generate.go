@@ -0,0 +1,98 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package snapshot
+
+import (
+	"github.com/nebulasio/go-nebulas/common/trie"
+	"github.com/nebulasio/go-nebulas/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// loadGeneratorMarker reads the progress marker left by a previous,
+// possibly interrupted, generator run. It returns (nil, true) when no
+// marker is stored, which means generation has either never started on
+// an empty disk layer or already finished.
+func loadGeneratorMarker(db storage.Storage) ([]byte, bool) {
+	marker, err := db.Get(snapshotGeneratorKey)
+	if err != nil || len(marker) == 0 {
+		return nil, true
+	}
+	return marker, false
+}
+
+// generateSnapshot rebuilds dl's flat key/value entries from stateTrie,
+// walking it in address-hash order and persisting a progress marker after
+// every account so a crash can resume instead of restarting from scratch.
+// It is meant to run in its own goroutine; dl.genPending is closed once it
+// finishes.
+func generateSnapshot(dl *diskLayer, stateTrie *trie.BatchTrie) {
+	defer close(dl.genPending)
+
+	resumed := dl.genMarker != nil
+	processed := 0
+
+	iter, err := stateTrie.Iterator(dl.genMarker)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Snapshot generator failed to open state trie iterator.")
+		return
+	}
+
+	exist, err := iter.Next()
+	for exist && err == nil {
+		key, value := iter.Key(), iter.Value()
+
+		if err = dl.db.Put(accountKey(key), value); err != nil {
+			break
+		}
+		if err = dl.db.Put(snapshotGeneratorKey, key); err != nil {
+			break
+		}
+
+		dl.lock.Lock()
+		dl.genMarker = key
+		dl.lock.Unlock()
+
+		processed++
+		exist, err = iter.Next()
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":      err,
+			"resumed":  resumed,
+			"progress": processed,
+		}).Error("Snapshot generation aborted.")
+		return
+	}
+
+	if err := dl.db.Del(snapshotGeneratorKey); err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Snapshot generator failed to clear progress marker.")
+		return
+	}
+
+	dl.lock.Lock()
+	dl.genMarker = nil
+	dl.lock.Unlock()
+
+	log.WithFields(log.Fields{
+		"root":     dl.root.Hex(),
+		"accounts": processed,
+		"resumed":  resumed,
+	}).Info("Snapshot disk layer generation complete.")
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Package snapshot implements a layered cache of the account state that
+// lets reads avoid walking the state trie node-by-node. It is organised
+// the same way as go-ethereum's state snapshot: a single flat diskLayer
+// holds the last fully committed state, and a stack of diffLayers, one per
+// pending block, stores only what that block changed. Reads walk the
+// stack from newest to oldest; a layer whose bloom filter proves a key
+// cannot be there is passed over without a map lookup, and the disk layer
+// is consulted only after every diff layer above it has missed.
+package snapshot
+
+import (
+	"errors"
+
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+)
+
+// Errors returned by the snapshot tree.
+var (
+	// ErrSnapshotStale is returned from data accessors if the underlying
+	// layer had been flattened/modified and the accessor is no longer
+	// able to guarantee a consistent view of the old state.
+	ErrSnapshotStale = errors.New("snapshot stale")
+
+	// ErrNotCoveredYet is returned from data accessors if the underlying
+	// disk layer is still generating snapshot entries and the requested
+	// key has not been indexed yet.
+	ErrNotCoveredYet = errors.New("snapshot not yet covered")
+
+	// ErrNotFound is returned from data accessors if a key is not present
+	// in any of the layers, all the way down to the disk layer.
+	ErrNotFound = errors.New("snapshot: key not found")
+)
+
+// Snapshot represents the state of a blockchain account and its storage
+// as of a given state trie root, without requiring trie node lookups.
+type Snapshot interface {
+	// Root returns the state trie root hash this snapshot belongs to.
+	Root() byteutils.Hash
+
+	// Account returns the RLP/protobuf encoded account blob for the given
+	// address hash, or ErrNotFound if it does not exist.
+	Account(addrHash byteutils.Hash) ([]byte, error)
+
+	// Storage returns the value of a contract storage slot for the given
+	// address hash and storage key hash, or ErrNotFound if it does not
+	// exist.
+	Storage(addrHash, storageHash byteutils.Hash) ([]byte, error)
+
+	// Parent returns the subsequent layer in the stack, or nil for the
+	// disk layer.
+	Parent() Snapshot
+
+	// Stale returns whether this layer has become outdated because it, or
+	// one of its ancestors, has been flattened into the disk layer.
+	Stale() bool
+}
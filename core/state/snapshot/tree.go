@@ -0,0 +1,182 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package snapshot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/nebulasio/go-nebulas/common/trie"
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+	log "github.com/sirupsen/logrus"
+)
+
+// FlattenDepth is the default number of diffLayers callers should allow to
+// stack up behind the disk layer, via Cap, before the oldest one is
+// flattened into it.
+const FlattenDepth = 128
+
+// Tree wraps the disk layer and the stack of diffLayers built on top of
+// it, and is the entry point callers use to look up a Snapshot for a
+// given state root or to extend the stack with a newly committed block.
+type Tree struct {
+	storage storage.Storage
+	layers  map[byteutils.HexHash]Snapshot
+
+	lock sync.RWMutex
+}
+
+// New creates a snapshot Tree rooted at diskRoot. If a previous,
+// interrupted generator run left a progress marker behind, it resumes that
+// run in a background goroutine that rebuilds the flat disk layer from
+// stateTrie. A disk layer with no stored marker is taken as fully
+// generated, so no generation starts on a first run against an existing
+// chain.
+func New(diskRoot byteutils.Hash, db storage.Storage, stateTrie *trie.BatchTrie) *Tree {
+	dl := &diskLayer{
+		db:         db,
+		root:       diskRoot,
+		genPending: make(chan struct{}),
+	}
+	if marker, done := loadGeneratorMarker(db); !done {
+		dl.genMarker = marker
+		go generateSnapshot(dl, stateTrie)
+	} else {
+		close(dl.genPending)
+	}
+
+	t := &Tree{
+		storage: db,
+		layers:  make(map[byteutils.HexHash]Snapshot),
+	}
+	t.layers[diskRoot.Hex()] = dl
+	return t
+}
+
+// Snapshot returns the Snapshot for the given state trie root, or nil if
+// the tree has no layer for it.
+func (t *Tree) Snapshot(root byteutils.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.layers[root.Hex()]
+}
+
+// Update extends the tree with a new diffLayer describing what block
+// newRoot changed relative to parentRoot: the accounts and storage slots
+// it dirtied, keyed by their address (and storage) hashes, with a nil
+// value blob meaning the entry was deleted.
+func (t *Tree) Update(parentRoot, newRoot byteutils.Hash, dirtyAccounts map[byteutils.HexHash][]byte, dirtyStorage map[byteutils.HexHash]map[byteutils.HexHash][]byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.layers[newRoot.Hex()]; ok {
+		return nil
+	}
+	parent, ok := t.layers[parentRoot.Hex()]
+	if !ok {
+		return fmt.Errorf("snapshot: unknown parent root %s", parentRoot.Hex())
+	}
+	t.layers[newRoot.Hex()] = newDiffLayer(parent, newRoot, dirtyAccounts, dirtyStorage)
+	return nil
+}
+
+// Cap enforces that root's ancestry contains no more than layers
+// diffLayers: when it holds more, the single oldest diffLayer is flattened
+// into the disk layer. Each call flattens at most one layer.
+func (t *Tree) Cap(root byteutils.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snap, ok := t.layers[root.Hex()]
+	if !ok {
+		return fmt.Errorf("snapshot: unknown root %s", root.Hex())
+	}
+	diff, ok := snap.(*diffLayer)
+	if !ok {
+		return nil // already the disk layer
+	}
+	if diff.depth() <= layers {
+		return nil
+	}
+	return t.flattenOldest(diff)
+}
+
+// flattenOldest walks from diff down to the oldest diffLayer resting
+// directly on the disk layer and merges it into the disk layer, then
+// rewires every layer that pointed at it to point at the disk layer
+// instead. Layers are merged one at a time so a crash mid-flatten leaves
+// the tree in a recoverable state: the disk layer on disk is always a
+// superset of exactly the flattened layers it has already absorbed.
+func (t *Tree) flattenOldest(diff *diffLayer) error {
+	var chain []*diffLayer
+	for cur := diff; ; {
+		chain = append(chain, cur)
+		parent, ok := cur.Parent().(*diffLayer)
+		if !ok {
+			break
+		}
+		cur = parent
+	}
+	// chain[len-1] rests directly on the disk layer; flatten it.
+	oldest := chain[len(chain)-1]
+	base, ok := oldest.Parent().(*diskLayer)
+	if !ok {
+		return fmt.Errorf("snapshot: disk layer missing below root %s", oldest.root.Hex())
+	}
+
+	newBase := &diskLayer{
+		db:         t.storage,
+		root:       oldest.root,
+		genMarker:  base.genMarker,
+		genPending: base.genPending,
+	}
+	if err := newBase.merge(oldest); err != nil {
+		return err
+	}
+
+	base.lock.Lock()
+	base.stale = true
+	base.lock.Unlock()
+
+	oldest.lock.Lock()
+	oldest.stale = true
+	oldest.lock.Unlock()
+
+	t.layers[oldest.root.Hex()] = newBase
+	// base's own root entry now names a stale disk layer; drop it so the
+	// map doesn't grow by one entry every time a disk layer is superseded.
+	// Any other diffLayer that rested on base, beside oldest, is not
+	// re-pointed and reads as stale from here on.
+	if baseKey := base.root.Hex(); baseKey != oldest.root.Hex() {
+		delete(t.layers, baseKey)
+	}
+	for _, snap := range t.layers {
+		if d, ok := snap.(*diffLayer); ok && d.Parent() == oldest {
+			d.lock.Lock()
+			d.parent = newBase
+			d.lock.Unlock()
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"root": oldest.root.Hex(),
+	}).Debug("Snapshot tree flattened oldest diff layer into disk layer.")
+	return nil
+}
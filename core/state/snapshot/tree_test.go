@@ -0,0 +1,99 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+)
+
+// newTestTree builds a Tree whose disk layer is already fully generated,
+// skipping New's background generator so tests don't need a real state
+// trie to iterate.
+func newTestTree(db storage.Storage, diskRoot byteutils.Hash) *Tree {
+	dl := &diskLayer{db: db, root: diskRoot, genPending: make(chan struct{})}
+	close(dl.genPending)
+	tree := &Tree{storage: db, layers: make(map[byteutils.HexHash]Snapshot)}
+	tree.layers[diskRoot.Hex()] = dl
+	return tree
+}
+
+// TestFlattenedLayerStaysReadable is a regression test for the key
+// encoding bug where merge built flat keys out of the raw bytes of a
+// HexHash instead of decoding it first, silently dropping every account a
+// flatten was supposed to preserve.
+func TestFlattenedLayerStaysReadable(t *testing.T) {
+	db := storage.NewMemoryStorage()
+	root0 := byteutils.Hash("root0")
+	tree := newTestTree(db, root0)
+
+	addr := byteutils.Hash("addr")
+	blob := []byte("account-blob")
+	root1 := byteutils.Hash("root1")
+	if err := tree.Update(root0, root1, map[byteutils.HexHash][]byte{addr.Hex(): blob}, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	diff, ok := tree.layers[root1.Hex()].(*diffLayer)
+	if !ok {
+		t.Fatalf("expected a diffLayer for root1")
+	}
+	if err := tree.flattenOldest(diff); err != nil {
+		t.Fatalf("flattenOldest failed: %v", err)
+	}
+
+	snap := tree.Snapshot(root1)
+	if snap == nil {
+		t.Fatalf("root1 should still resolve to a layer after flattening")
+	}
+	got, err := snap.Account(addr)
+	if err != nil {
+		t.Fatalf("account unreadable after flatten: %v", err)
+	}
+	if string(got) != string(blob) {
+		t.Fatalf("got %q, want %q", got, blob)
+	}
+}
+
+// TestFlattenPrunesSupersededDiskRoot is a regression test for
+// flattenOldest leaking one map entry per flatten: the old disk layer's
+// own root key must be dropped once a new disk layer takes its place,
+// since nothing can reach it any more.
+func TestFlattenPrunesSupersededDiskRoot(t *testing.T) {
+	db := storage.NewMemoryStorage()
+	root0 := byteutils.Hash("root0")
+	tree := newTestTree(db, root0)
+
+	root1 := byteutils.Hash("root1")
+	if err := tree.Update(root0, root1, map[byteutils.HexHash][]byte{}, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := tree.flattenOldest(tree.layers[root1.Hex()].(*diffLayer)); err != nil {
+		t.Fatalf("flattenOldest failed: %v", err)
+	}
+
+	if _, ok := tree.layers[root0.Hex()]; ok {
+		t.Fatalf("superseded disk layer root %s should have been pruned", root0.Hex())
+	}
+	if len(tree.layers) != 1 {
+		t.Fatalf("expected exactly one layer left, got %d", len(tree.layers))
+	}
+}
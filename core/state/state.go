@@ -25,6 +25,8 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/nebulasio/go-nebulas/common/trie"
 	"github.com/nebulasio/go-nebulas/core/pb"
+	"github.com/nebulasio/go-nebulas/core/state/snapshot"
+	"github.com/nebulasio/go-nebulas/crypto/hash"
 	"github.com/nebulasio/go-nebulas/storage"
 	"github.com/nebulasio/go-nebulas/util"
 	"github.com/nebulasio/go-nebulas/util/byteutils"
@@ -35,10 +37,12 @@ import (
 var (
 	ErrBalanceInsufficient = errors.New("cannot subtract a value which is bigger than current balance")
 	ErrAccountNotFound     = errors.New("cannot found account in storage")
+	ErrKeyNotFound         = errors.New("cannot found key in storage")
 )
 
 // account info in state Trie
 type account struct {
+	addr    byteutils.Hash
 	balance *util.Uint128
 	nonce   uint64
 	// UserType: Global Storage
@@ -46,9 +50,47 @@ type account struct {
 	variables *trie.BatchTrie
 	// ContractType: Transaction Hash
 	birthPlace byteutils.Hash
-}
-
-// ToBytes converts domain Account to bytes
+	// ContractType: hash of the deployed bytecode, stored separately from
+	// variables under this key in storage
+	codeHash byteutils.Hash
+
+	// suicided marks an account that called SELFDESTRUCT during the
+	// current batch. It is in-memory only: accountState.Commit deletes a
+	// suicided account instead of re-encoding it, so the flag never needs
+	// to survive a Commit.
+	suicided bool
+
+	// journal receives a reversible entry for every mutation made through
+	// this account, so accountState can unwind back to any Snapshot id.
+	// nil for an account not obtained through an accountState (e.g. one
+	// freshly created by tests), in which case mutations simply aren't
+	// journaled.
+	journal *journal
+
+	// state is the accountState this account was handed out by, used to
+	// read through to its layered snapshot for storage lookups. nil for
+	// an account not obtained through an accountState, in which case Get
+	// always falls back to the variables trie.
+	state *accountState
+
+	// dirtyStorage holds every storage key this account's Put/Del touched
+	// since the last Commit, keyed by the raw key bytes; a nil value
+	// means the key was deleted. accountState.Commit drains this into the
+	// snapshot diff layer it publishes, the storage-side counterpart of
+	// dirtyAccount.
+	dirtyStorage map[string][]byte
+
+	storage storage.Storage
+}
+
+// ToBytes converts domain Account to bytes.
+//
+// TODO(chunk0-5): codeHash is not encoded here yet. Wiring it through
+// requires a CodeHash field on corepb.Account, which lives outside this
+// package (generated from account.proto) and hasn't been added; encoding
+// it against a field that doesn't exist would break every account, not
+// just contract ones. Add the proto field first, then extend ToBytes and
+// FromBytes together in one change.
 func (acc *account) ToBytes() ([]byte, error) {
 	value, err := acc.balance.ToFixedSizeByteSlice()
 	if err != nil {
@@ -80,6 +122,8 @@ func (acc *account) FromBytes(bytes []byte, storage storage.Storage) error {
 	acc.balance = value
 	acc.nonce = pbAcc.Nonce
 	acc.birthPlace = pbAcc.BirthPlace
+	// codeHash isn't decoded from pbAcc yet; see the TODO on ToBytes.
+	acc.storage = storage
 	acc.variables, err = trie.NewBatchTrie(pbAcc.VarsHash, storage)
 	if err != nil {
 		return err
@@ -107,6 +151,43 @@ func (acc *account) BirthPlace() byteutils.Hash {
 	return acc.birthPlace
 }
 
+// Code returns the contract's deployed bytecode, or nil if the account
+// has no codeHash set. ToBytes and FromBytes do not carry codeHash, so an
+// account decoded from the state trie always returns nil here, even if
+// SetCode was called on it before the last Commit.
+func (acc *account) Code() ([]byte, error) {
+	if len(acc.codeHash) == 0 {
+		return nil, nil
+	}
+	return acc.storage.Get(acc.codeHash)
+}
+
+// SetCode stores code in the underlying storage keyed by its hash, and
+// points the account's CodeHash at it.
+func (acc *account) SetCode(code []byte) error {
+	codeHash := hash.Sha3256(code)
+	if err := acc.storage.Put(codeHash, code); err != nil {
+		return err
+	}
+	acc.codeHash = codeHash
+	return nil
+}
+
+// Suicide reports whether the account has been marked for deletion via
+// MarkSuicided during the current batch.
+func (acc *account) Suicide() bool {
+	return acc.suicided
+}
+
+// MarkSuicided flags the account to be deleted, rather than re-encoded,
+// on the next accountState.Commit.
+func (acc *account) MarkSuicided() {
+	if acc.journal != nil {
+		acc.journal.append(suicideChange{acc: acc})
+	}
+	acc.suicided = true
+}
+
 // BeginBatch begins a batch task
 func (acc *account) BeginBatch() {
 	log.Info("Account Begin.")
@@ -131,11 +212,17 @@ func (acc *account) RollBack() {
 
 // IncreNonce by 1
 func (acc *account) IncreNonce() {
+	if acc.journal != nil {
+		acc.journal.append(nonceChange{acc: acc, prev: acc.nonce})
+	}
 	acc.nonce++
 }
 
 // AddBalance to an account
 func (acc *account) AddBalance(value *util.Uint128) {
+	if acc.journal != nil {
+		acc.journal.append(balanceChange{acc: acc, prev: acc.copyBalance()})
+	}
 	acc.balance.Add(acc.balance.Int, value.Int)
 }
 
@@ -144,23 +231,103 @@ func (acc *account) SubBalance(value *util.Uint128) error {
 	if acc.balance.Cmp(value.Int) < 0 {
 		return ErrBalanceInsufficient
 	}
+	if acc.journal != nil {
+		acc.journal.append(balanceChange{acc: acc, prev: acc.copyBalance()})
+	}
 	acc.balance.Sub(acc.balance.Int, value.Int)
 	return nil
 }
 
+// copyBalance returns an independent copy of the account's current
+// balance, so it can be journaled before an in-place mutation.
+func (acc *account) copyBalance() *util.Uint128 {
+	prev := util.NewUint128()
+	prev.Add(prev.Int, acc.balance.Int)
+	return prev
+}
+
 // Put into account's storage
 func (acc *account) Put(key []byte, value []byte) error {
+	if acc.journal != nil {
+		prev, err := acc.variables.Get(key)
+		prevDirty, hadDirty := acc.dirtyStorage[string(key)]
+		acc.journal.append(storagePut{acc: acc, key: key, prev: prev, existed: err == nil, prevDirty: prevDirty, hadDirty: hadDirty})
+	}
+	acc.setDirtyStorage(key, value)
 	_, err := acc.variables.Put(key, value)
 	return err
 }
 
-// Get from account's storage
+// Get from account's storage, preferring this batch's own uncommitted
+// writes, then the layered snapshot, and falling back to the variables
+// trie, the same read order getAccount uses for accounts.
 func (acc *account) Get(key []byte) ([]byte, error) {
+	if value, ok := acc.dirtyStorage[string(key)]; ok {
+		if value == nil {
+			return nil, ErrKeyNotFound
+		}
+		return value, nil
+	}
+	if value, ok := acc.getStorageFromSnapshot(key); ok {
+		if value == nil {
+			return nil, ErrKeyNotFound
+		}
+		return value, nil
+	}
 	return acc.variables.Get(key)
 }
 
+// getStorageFromSnapshot looks key up in the layer acc.state.snaps has
+// published for acc.state.root, the storage-side counterpart of
+// accountState.getAccountFromSnapshot. It returns ok=false whenever there
+// is no definitive hit, so Get always has the variables trie to fall
+// back to.
+func (acc *account) getStorageFromSnapshot(key []byte) ([]byte, bool) {
+	if acc.state == nil || acc.state.snaps == nil || len(acc.addr) == 0 {
+		return nil, false
+	}
+	snap := acc.state.snaps.Snapshot(acc.state.root)
+	if snap == nil {
+		return nil, false
+	}
+	blob, err := snap.Storage(acc.addr, byteutils.Hash(key))
+	if err != nil {
+		return nil, false
+	}
+	return blob, true
+}
+
+// setDirtyStorage records value (nil for a delete) as key's pending
+// in-batch write, so Get can read it back before Commit and Commit can
+// harvest it into the snapshot diff layer.
+func (acc *account) setDirtyStorage(key []byte, value []byte) {
+	if acc.dirtyStorage == nil {
+		acc.dirtyStorage = make(map[string][]byte)
+	}
+	acc.dirtyStorage[string(key)] = value
+}
+
+// revertDirtyStorage undoes setDirtyStorage, restoring key's prior
+// dirtyStorage entry (or clearing it if it hadn't been touched yet this
+// batch), the dirtyStorage counterpart of a storagePut/storageDelete
+// journal entry's variables-trie restore.
+func (acc *account) revertDirtyStorage(key []byte, prevDirty []byte, hadDirty bool) {
+	if hadDirty {
+		acc.setDirtyStorage(key, prevDirty)
+		return
+	}
+	delete(acc.dirtyStorage, string(key))
+}
+
 // Del from account's storage
 func (acc *account) Del(key []byte) error {
+	if acc.journal != nil {
+		if prev, err := acc.variables.Get(key); err == nil {
+			prevDirty, hadDirty := acc.dirtyStorage[string(key)]
+			acc.journal.append(storageDelete{acc: acc, key: key, prev: prev, prevDirty: prevDirty, hadDirty: hadDirty})
+		}
+	}
+	acc.setDirtyStorage(key, nil)
 	if _, err := acc.variables.Del(key); err != nil {
 		return err
 	}
@@ -188,6 +355,29 @@ type accountState struct {
 	dirtyAccount map[byteutils.HexHash]Account
 	batching     bool
 	storage      storage.Storage
+
+	// journal records every individual mutation made to any account
+	// handed out by this accountState, so a caller can unwind down to any
+	// Snapshot id without discarding the whole batch.
+	journal *journal
+
+	// root is the state trie root this accountState was constructed with,
+	// or the root of the last Commit. It is the key snaps's layer for the
+	// current, fully-committed state is published under.
+	root byteutils.Hash
+
+	// snaps is the optional layered snapshot this accountState publishes
+	// diff layers to on Commit, and reads through on lookup misses in
+	// dirtyAccount. It is nil until SetSnapshot is called, in which case
+	// reads and writes both fall back to trie-only behavior as before.
+	snaps *snapshot.Tree
+}
+
+// SetSnapshot attaches a layered snapshot tree to this accountState. Once
+// set, every Commit publishes a new diff layer on top of it, keyed by the
+// resulting state trie root.
+func (as *accountState) SetSnapshot(snaps *snapshot.Tree) {
+	as.snaps = snaps
 }
 
 // NewAccountState create a new account state
@@ -201,6 +391,8 @@ func NewAccountState(root byteutils.Hash, storage storage.Storage) (AccountState
 		dirtyAccount: make(map[byteutils.HexHash]Account),
 		batching:     false,
 		storage:      storage,
+		journal:      newJournal(),
+		root:         root,
 	}, nil
 }
 
@@ -214,12 +406,19 @@ func (as *accountState) recordDirtyAccount(addr byteutils.Hash, acc Account) {
 func (as *accountState) newAccount(addr byteutils.Hash, birthPlace byteutils.Hash) Account {
 	varTrie, _ := trie.NewBatchTrie(nil, as.storage)
 	acc := &account{
+		addr:       addr,
 		balance:    util.NewUint128(),
 		nonce:      0,
 		variables:  varTrie,
 		birthPlace: birthPlace,
+		journal:    as.journal,
+		state:      as,
+		storage:    as.storage,
 	}
 	as.recordDirtyAccount(addr, acc)
+	if as.batching {
+		as.journal.append(createAccount{state: as, addr: addr.Hex()})
+	}
 	return acc
 }
 
@@ -228,6 +427,12 @@ func (as *accountState) getAccount(addr byteutils.Hash) (Account, error) {
 	if acc, ok := as.dirtyAccount[addr.Hex()]; ok {
 		return acc, nil
 	}
+	// search in the layered snapshot, if one is attached, before walking
+	// the trie node by node
+	if acc, ok := as.getAccountFromSnapshot(addr); ok {
+		as.recordDirtyAccount(addr, acc)
+		return acc, nil
+	}
 	// search in storage
 	bytes, err := as.stateTrie.Get(addr)
 	if err == nil {
@@ -236,12 +441,43 @@ func (as *accountState) getAccount(addr byteutils.Hash) (Account, error) {
 		if err != nil {
 			return nil, err
 		}
+		acc.addr = addr
+		acc.journal = as.journal
+		acc.state = as
 		as.recordDirtyAccount(addr, acc)
 		return acc, nil
 	}
 	return nil, ErrAccountNotFound
 }
 
+// getAccountFromSnapshot looks addr up in the layer of as.snaps published
+// for as.root, the O(1) path the snapshot package exists to provide. It
+// returns ok=false, rather than an error, on anything short of a
+// confirmed hit, so callers always have a trie-backed fallback: no
+// attached snapshot, a layer still mid-generation, a stale layer, or the
+// key genuinely not being present.
+func (as *accountState) getAccountFromSnapshot(addr byteutils.Hash) (Account, bool) {
+	if as.snaps == nil {
+		return nil, false
+	}
+	snap := as.snaps.Snapshot(as.root)
+	if snap == nil {
+		return nil, false
+	}
+	blob, err := snap.Account(addr)
+	if err != nil {
+		return nil, false
+	}
+	acc := new(account)
+	if err := acc.FromBytes(blob, as.storage); err != nil {
+		return nil, false
+	}
+	acc.addr = addr
+	acc.journal = as.journal
+	acc.state = as
+	return acc, true
+}
+
 // RootHash return root hash of account state
 func (as *accountState) RootHash() byteutils.Hash {
 	for addr, acc := range as.dirtyAccount {
@@ -287,17 +523,87 @@ func (as *accountState) BeginBatch() {
 	}
 }
 
+// Snapshot returns an id identifying the journal's current length. Pass
+// it to RevertToSnapshot to undo every mutation made to any account
+// since this call, without discarding mutations made before it.
+func (as *accountState) Snapshot() int {
+	return as.journal.length()
+}
+
+// RevertToSnapshot undoes every account mutation recorded since id was
+// returned by Snapshot, restoring balances, nonces and storage in-place
+// on the cached account objects. This is what lets a failed inner
+// contract call be unwound without discarding the whole batch.
+func (as *accountState) RevertToSnapshot(id int) {
+	as.journal.revert(id)
+}
+
+// pruneSuicidedAccount drops the code blob a suicided contract owned.
+// Its variables trie is left for the trie layer's own garbage collection,
+// the same as any other account whose state trie entry is deleted.
+func (as *accountState) pruneSuicidedAccount(acc *account) {
+	if len(acc.codeHash) == 0 {
+		return
+	}
+	if err := as.storage.Del(acc.codeHash); err != nil {
+		log.WithFields(log.Fields{
+			"err":      err,
+			"codeHash": byteutils.Hex(acc.codeHash),
+		}).Warn("Failed to prune suicided account's code.")
+	}
+}
+
 // Commit a batch task
 func (as *accountState) Commit() {
+	parentRoot := as.root
+	dirtyAccounts := make(map[byteutils.HexHash][]byte, len(as.dirtyAccount))
+	dirtyStorage := make(map[byteutils.HexHash]map[byteutils.HexHash][]byte, len(as.dirtyAccount))
+
 	for addr, acc := range as.dirtyAccount {
-		acc.Commit()
 		delete(as.dirtyAccount, addr)
-		bytes, _ := acc.ToBytes()
 		key, _ := addr.Hash()
+
+		sa, ok := acc.(*account)
+		if ok && len(sa.dirtyStorage) > 0 {
+			slots := make(map[byteutils.HexHash][]byte, len(sa.dirtyStorage))
+			for k, v := range sa.dirtyStorage {
+				slots[byteutils.Hash(k).Hex()] = v
+			}
+			dirtyStorage[addr] = slots
+			sa.dirtyStorage = nil
+		}
+
+		if ok && sa.suicided {
+			as.stateTrie.Del(key)
+			as.pruneSuicidedAccount(sa)
+			dirtyAccounts[addr] = nil
+			continue
+		}
+
+		acc.Commit()
+		bytes, _ := acc.ToBytes()
 		as.stateTrie.Put(key, bytes)
+		dirtyAccounts[addr] = bytes
 	}
 	as.stateTrie.Commit()
 	as.batching = false
+	as.journal.reset()
+
+	newRoot := as.stateTrie.RootHash()
+	as.root = newRoot
+
+	if as.snaps != nil {
+		if err := as.snaps.Update(parentRoot, newRoot, dirtyAccounts, dirtyStorage); err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("Failed to publish snapshot diff layer on Commit.")
+		} else if err := as.snaps.Cap(newRoot, snapshot.FlattenDepth); err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("Failed to cap snapshot layer stack.")
+		}
+	}
+
 	log.WithFields(log.Fields{
 		"AccountState": as,
 	}).Info("AccountState Commit.")
@@ -306,6 +612,7 @@ func (as *accountState) Commit() {
 // RollBack a batch task
 func (as *accountState) RollBack() {
 	as.stateTrie.RollBack()
+	as.journal.revert(0)
 	for addr, acc := range as.dirtyAccount {
 		acc.RollBack()
 		delete(as.dirtyAccount, addr)
@@ -322,12 +629,56 @@ func (as *accountState) Clone() (AccountState, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &accountState{
+
+	// The clone must be able to evolve independently of as: give it its
+	// own journal, and its own copy of every cached account, so mutating
+	// one side after Clone never retroactively changes the other (this is
+	// what lets a SimulatedBackend seal a block and keep working on a
+	// fresh pending state built on top of it).
+	cloneJournal := newJournal()
+	dirtyAccount := make(map[byteutils.HexHash]Account, len(as.dirtyAccount))
+	var clonedAccounts []*account
+	for addr, acc := range as.dirtyAccount {
+		sa, ok := acc.(*account)
+		if !ok {
+			dirtyAccount[addr] = acc
+			continue
+		}
+		clonedVars, err := sa.variables.Clone()
+		if err != nil {
+			return nil, err
+		}
+		clonedAcc := *sa
+		clonedAcc.balance = sa.copyBalance()
+		clonedAcc.variables = clonedVars
+		clonedAcc.journal = cloneJournal
+		if sa.dirtyStorage != nil {
+			clonedAcc.dirtyStorage = make(map[string][]byte, len(sa.dirtyStorage))
+			for k, v := range sa.dirtyStorage {
+				clonedAcc.dirtyStorage[k] = v
+			}
+		}
+		dirtyAccount[addr] = &clonedAcc
+		clonedAccounts = append(clonedAccounts, &clonedAcc)
+	}
+
+	cloned := &accountState{
 		stateTrie:    stateTrie,
-		dirtyAccount: as.dirtyAccount,
+		dirtyAccount: dirtyAccount,
 		batching:     as.batching,
 		storage:      as.storage,
-	}, nil
+		journal:      cloneJournal,
+		root:         as.root,
+		snaps:        as.snaps,
+	}
+	// Each cloned account's state back-reference must point at cloned,
+	// not as, or its Get would keep reading as's snapshot layer after the
+	// two states have diverged; cloned doesn't exist until the copy loop
+	// above finishes, hence this second pass.
+	for _, acc := range clonedAccounts {
+		acc.state = cloned
+	}
+	return cloned, nil
 }
 
 func (as *accountState) String() string {